@@ -0,0 +1,127 @@
+package main
+
+import "sync"
+
+// eventBufferSize is the per-subscriber channel buffer; a subscriber that
+// falls this far behind receives an "overflow" event instead of blocking
+// the publisher.
+const eventBufferSize = 16
+
+// eventHistorySize is the number of recent events retained for
+// Last-Event-ID reconnect catch-up.
+const eventHistorySize = 256
+
+// Event describes a single cache mutation published to subscribers.
+type Event struct {
+	ID     int64  `json:"id"`
+	Op     string `json:"op"` // opSet, opDelete, or "overflow"
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Expire int64  `json:"expire,omitempty"` // unix nanos; 0 means no expiry
+}
+
+// eventBus fans out cache mutation Events to subscribers, retaining a
+// short history so a reconnecting SSE client can catch up via
+// Last-Event-ID. The nil *eventBus behaves as an inert bus with no
+// subscribers and no history, so a zero-value Cache works without one.
+type eventBus struct {
+	mu          sync.Mutex
+	nextID      int64
+	subscribers map[chan Event]struct{}
+	history     []Event // ring buffer, oldest first
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a new subscriber and returns a buffered channel of
+// future events plus an unsubscribe func. Callers must call unsubscribe
+// exactly once, typically via defer, to avoid leaking the channel.
+func (b *eventBus) Subscribe() (<-chan Event, func()) {
+	if b == nil {
+		ch := make(chan Event)
+		close(ch)
+		return ch, func() {}
+	}
+
+	ch := make(chan Event, eventBufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+		b.mu.Unlock()
+	}
+	return ch, unsubscribe
+}
+
+// publish assigns the next event ID, appends to history, and delivers to
+// every subscriber with a non-blocking send. A subscriber whose buffer is
+// full is sent a terse "overflow" event instead, so it knows to resync,
+// rather than stalling the publisher.
+func (b *eventBus) publish(ev Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	ev.ID = b.nextID
+	b.history = append(b.history, ev)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+			// Buffer is full: drop the oldest queued event to make room,
+			// then let the subscriber know it missed something instead
+			// of silently losing ev.
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- Event{ID: ev.ID, Op: "overflow"}:
+			default:
+			}
+		}
+	}
+}
+
+// since returns every retained event with ID > lastID, for Last-Event-ID
+// reconnect catch-up. ok is false if lastID predates the retained
+// history, meaning the client missed events this bus can no longer
+// supply.
+func (b *eventBus) since(lastID int64) (events []Event, ok bool) {
+	if b == nil {
+		return nil, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.history) == 0 {
+		return nil, true
+	}
+	if oldest := b.history[0].ID; lastID < oldest-1 {
+		return nil, false
+	}
+	for _, ev := range b.history {
+		if ev.ID > lastID {
+			events = append(events, ev)
+		}
+	}
+	return events, true
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBusDeliversPublishedEvent(t *testing.T) {
+	bus := newEventBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	bus.publish(Event{Op: opSet, Key: "k", Value: "v"})
+
+	select {
+	case ev := <-ch:
+		if ev.Op != opSet || ev.Key != "k" || ev.Value != "v" || ev.ID != 1 {
+			t.Errorf("got %+v, want Op=%s Key=k Value=v ID=1", ev, opSet)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for published event")
+	}
+}
+
+func TestEventBusSlowConsumerGetsOverflow(t *testing.T) {
+	bus := newEventBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < eventBufferSize+2; i++ {
+		bus.publish(Event{Op: opSet, Key: "k"})
+	}
+
+	var sawOverflow bool
+	for i := 0; i < eventBufferSize; i++ {
+		ev := <-ch
+		if ev.Op == "overflow" {
+			sawOverflow = true
+		}
+	}
+	if !sawOverflow {
+		t.Error("expected a slow consumer to receive an overflow event")
+	}
+}
+
+func TestEventBusSinceReturnsHistory(t *testing.T) {
+	bus := newEventBus()
+	bus.publish(Event{Op: opSet, Key: "a"})
+	bus.publish(Event{Op: opSet, Key: "b"})
+	bus.publish(Event{Op: opDelete, Key: "a"})
+
+	events, ok := bus.since(1)
+	if !ok {
+		t.Fatal("since(1) ok = false, want true")
+	}
+	if len(events) != 2 || events[0].Key != "b" || events[1].Key != "a" {
+		t.Errorf("since(1) = %+v, want [b delete-a]", events)
+	}
+
+	if _, ok := bus.since(0); !ok {
+		t.Error("since(0) ok = false, want true (nothing retained was dropped)")
+	}
+}
+
+func TestEventBusUnsubscribeClosesChannel(t *testing.T) {
+	bus := newEventBus()
+	ch, unsubscribe := bus.Subscribe()
+	unsubscribe()
+
+	if _, open := <-ch; open {
+		t.Error("channel should be closed after unsubscribe")
+	}
+
+	// Publishing after everyone unsubscribed must not panic.
+	bus.publish(Event{Op: opSet, Key: "k"})
+}
+
+func TestSSEHandlerStreamsSetEvent(t *testing.T) {
+	cache := NewCache("http://localhost:8080", nil, 0)
+	handler := sseHandler(cache)
+
+	req := httptest.NewRequest(http.MethodGet, "/updates", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler(rec, req)
+		close(done)
+	}()
+
+	time.Sleep(20 * time.Millisecond) // let the handler subscribe first
+	if err := cache.Set("key", "value", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler did not return after context cancellation")
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "event: set") {
+		t.Errorf("body = %q, want it to contain %q", body, "event: set")
+	}
+	if !strings.Contains(body, `"key":"key"`) {
+		t.Errorf("body = %q, want it to contain the published key", body)
+	}
+}
+
+func TestSSEHandlerDoesNotLeakGoroutines(t *testing.T) {
+	cache := NewCache("http://localhost:8080", nil, 0)
+	handler := sseHandler(cache)
+
+	runtime.GC()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/updates", nil)
+		ctx, cancel := context.WithCancel(req.Context())
+		req = req.WithContext(ctx)
+		rec := httptest.NewRecorder()
+
+		done := make(chan struct{})
+		go func() {
+			handler(rec, req)
+			close(done)
+		}()
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("handler did not return after context cancellation")
+		}
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	runtime.GC()
+	after := runtime.NumGoroutine()
+	if after > before+5 {
+		t.Errorf("NumGoroutine after 20 subscribe/cancel cycles = %d, want <= %d", after, before+5)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultReplicas is the number of virtual nodes placed on the ring per
+// real peer, smoothing out load distribution across the key space.
+const defaultReplicas = 50
+
+// hashRing assigns keys to peers using consistent hashing over crc32
+// hashes of "peerAddr#vnodeIdx".
+type hashRing struct {
+	replicas int
+	keys     []uint32          // sorted virtual node hashes
+	hashMap  map[uint32]string // virtual node hash -> real peer address
+}
+
+func newHashRing(replicas int) *hashRing {
+	return &hashRing{
+		replicas: replicas,
+		hashMap:  make(map[uint32]string),
+	}
+}
+
+// add places replicas virtual nodes for each peer onto the ring.
+func (h *hashRing) add(peers ...string) {
+	for _, peer := range peers {
+		for i := 0; i < h.replicas; i++ {
+			hash := crc32.ChecksumIEEE([]byte(peer + "#" + strconv.Itoa(i)))
+			h.keys = append(h.keys, hash)
+			h.hashMap[hash] = peer
+		}
+	}
+	sort.Slice(h.keys, func(i, j int) bool { return h.keys[i] < h.keys[j] })
+}
+
+// get returns the peer owning key by walking clockwise to the nearest
+// virtual node, wrapping around to the first node past the end of the
+// ring.
+func (h *hashRing) get(key string) (string, bool) {
+	if len(h.keys) == 0 {
+		return "", false
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(h.keys), func(i int) bool { return h.keys[i] >= hash })
+	if idx == len(h.keys) {
+		idx = 0
+	}
+	return h.hashMap[h.keys[idx]], true
+}
+
+// HTTPPool implements PeerPicker over a set of HTTP peers arranged on a
+// consistent hash ring, mirroring groupcache's HTTPPool.
+type HTTPPool struct {
+	self string
+
+	mu        sync.RWMutex
+	ring      *hashRing
+	getters   map[string]*httpGetter
+	signer    *Signer           // signs outgoing replication ops; nil means unsigned
+	transport http.RoundTripper // nil means http.DefaultTransport
+}
+
+// NewHTTPPool creates an HTTPPool for the node at self, initially owning
+// the given peer addresses.
+func NewHTTPPool(self string, peers ...string) *HTTPPool {
+	p := &HTTPPool{self: self}
+	p.Set(peers...)
+	return p
+}
+
+// SetSigner configures the Signer used to sign outgoing replication ops
+// to every current and future peer. A nil signer leaves ops unsigned.
+func (p *HTTPPool) SetSigner(signer *Signer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.signer = signer
+	for _, g := range p.getters {
+		g.Signer = signer
+	}
+}
+
+// SetTransport configures the http.RoundTripper used for outgoing
+// requests to every current and future peer, e.g. to share a connection
+// pool across peers. A nil transport uses http.DefaultTransport.
+func (p *HTTPPool) SetTransport(transport http.RoundTripper) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.transport = transport
+	for _, g := range p.getters {
+		g.Transport = transport
+	}
+}
+
+// Set rebuilds the hash ring for the given peer addresses under a write
+// lock. self is always included so keys it owns resolve locally.
+func (p *HTTPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ring := newHashRing(defaultReplicas)
+	ring.add(append([]string{p.self}, peers...)...)
+	p.ring = ring
+
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, peer := range peers {
+		getters[peer] = &httpGetter{baseURL: peer, Signer: p.signer, Transport: p.transport}
+	}
+	p.getters = getters
+}
+
+// PickPeer returns the Peer owning key, or (nil, false) if self owns it.
+func (p *HTTPPool) PickPeer(key string) (Peer, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.ring == nil {
+		return nil, false
+	}
+	owner, ok := p.ring.get(key)
+	if !ok || owner == p.self {
+		return nil, false
+	}
+	getter, ok := p.getters[owner]
+	return getter, ok
+}
+
+// Peers returns the configured remote peer addresses (excluding self).
+func (p *HTTPPool) Peers() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	peers := make([]string, 0, len(p.getters))
+	for addr := range p.getters {
+		peers = append(peers, addr)
+	}
+	return peers
+}
+
+// httpGetter is a Peer backed by an HTTP client. Transport is exposed so
+// callers can share a single *http.Transport across getters for
+// connection reuse.
+type httpGetter struct {
+	baseURL   string
+	Transport http.RoundTripper
+	Signer    *Signer // signs outgoing replication ops; nil means unsigned
+}
+
+func (g *httpGetter) client() *http.Client {
+	return &http.Client{Transport: g.Transport}
+}
+
+// getResponse is the wire format for GET /get: the value plus its
+// absolute expiration (omitted means no expiry), so the requesting peer
+// can honor the owner's TTL in its own hot cache instead of caching the
+// value forever.
+type getResponse struct {
+	Value  string `json:"value"`
+	Expire int64  `json:"expire,omitempty"` // unix nanos; 0 means no expiry
+}
+
+// Get fetches key and its expiration from the peer's /get endpoint.
+func (g *httpGetter) Get(key string) (value string, expire time.Time, err error) {
+	u := fmt.Sprintf("%s/get?key=%s", g.baseURL, url.QueryEscape(key))
+	resp, err := g.client().Get(u)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("fetching %q from peer %s: %w", key, g.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", time.Time{}, errKeyNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("peer %s returned status %d", g.baseURL, resp.StatusCode)
+	}
+
+	var body getResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding response from peer %s: %w", g.baseURL, err)
+	}
+	if body.Expire == 0 {
+		return body.Value, time.Time{}, nil
+	}
+	return body.Value, time.Unix(0, body.Expire), nil
+}
+
+// Add forwards a set of key/value, with a non-zero ttl expressed as an
+// absolute expiration, to the peer via a signed ReplicationOp.
+func (g *httpGetter) Add(key, value string, ttl time.Duration) error {
+	op := ReplicationOp{Op: opSet, Key: key, Value: value}
+	if ttl > 0 {
+		op.Expire = time.Now().Add(ttl).UnixNano()
+	}
+	return g.postReplicate(op)
+}
+
+// Delete forwards a deletion of key to the peer via a signed
+// ReplicationOp.
+func (g *httpGetter) Delete(key string) error {
+	return g.postReplicate(ReplicationOp{Op: opDelete, Key: key})
+}
+
+// postReplicate signs (if g.Signer is set) and POSTs op to the peer's
+// /replicate endpoint.
+func (g *httpGetter) postReplicate(op ReplicationOp) error {
+	op, err := g.Signer.sign(op, time.Now())
+	if err != nil {
+		return fmt.Errorf("signing replication op for peer %s: %w", g.baseURL, err)
+	}
+
+	body, err := json.Marshal(op)
+	if err != nil {
+		return fmt.Errorf("encoding replication op for peer %s: %w", g.baseURL, err)
+	}
+
+	resp, err := g.client().Post(g.baseURL+"/replicate", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("posting replication op of %q to peer %s: %w", op.Key, g.baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer %s returned status %d", g.baseURL, resp.StatusCode)
+	}
+	return nil
+}
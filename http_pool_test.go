@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHashRingStableUnderPeerChurn(t *testing.T) {
+	base := newHashRing(defaultReplicas)
+	base.add("http://localhost:8080", "http://localhost:8081", "http://localhost:8082")
+
+	keys := make([]string, 1000)
+	owners := make(map[string]string, len(keys))
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		owner, ok := base.get(keys[i])
+		if !ok {
+			t.Fatalf("get(%q) = _, false; want an owner", keys[i])
+		}
+		owners[keys[i]] = owner
+	}
+
+	grown := newHashRing(defaultReplicas)
+	grown.add("http://localhost:8080", "http://localhost:8081", "http://localhost:8082", "http://localhost:8083")
+
+	moved := 0
+	for _, key := range keys {
+		owner, ok := grown.get(key)
+		if !ok {
+			t.Fatalf("get(%q) = _, false after growth; want an owner", key)
+		}
+		if owner != owners[key] {
+			moved++
+		}
+	}
+
+	// Consistent hashing should remap roughly 1/n of the keys when a peer
+	// is added to an n-peer ring, not redistribute everything.
+	if maxMoved := len(keys) / 2; moved > maxMoved {
+		t.Errorf("growing the ring moved %d/%d keys, want <= %d", moved, len(keys), maxMoved)
+	}
+}
+
+func TestHashRingGetEmpty(t *testing.T) {
+	ring := newHashRing(defaultReplicas)
+	if _, ok := ring.get("anykey"); ok {
+		t.Errorf("get on empty ring: ok = true, want false")
+	}
+}
+
+func TestHTTPPoolPickPeerSelfOwned(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8080", "http://localhost:8081", "http://localhost:8082")
+
+	sawRemote := false
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		peer, ok := pool.PickPeer(key)
+		if !ok {
+			continue // owned by self
+		}
+		sawRemote = true
+		if peer == nil {
+			t.Fatalf("PickPeer(%q) returned ok=true with a nil peer", key)
+		}
+	}
+	if !sawRemote {
+		t.Errorf("PickPeer never returned a remote peer across 1000 keys")
+	}
+}
+
+func TestHTTPPoolSetRebuildsRing(t *testing.T) {
+	pool := NewHTTPPool("http://localhost:8080", "http://localhost:8081")
+	if got := pool.Peers(); len(got) != 1 {
+		t.Fatalf("Peers() = %v, want 1 peer", got)
+	}
+
+	pool.Set("http://localhost:8081", "http://localhost:8082", "http://localhost:8083")
+	if got := pool.Peers(); len(got) != 3 {
+		t.Fatalf("Peers() after Set = %v, want 3 peers", got)
+	}
+}
+
+func TestHTTPGetterGetCarriesExpire(t *testing.T) {
+	wantExpire := time.Now().Add(time.Hour).Round(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(getResponse{Value: "v", Expire: wantExpire.UnixNano()})
+	}))
+	defer srv.Close()
+
+	g := &httpGetter{baseURL: srv.URL}
+	value, expire, err := g.Get("k")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if value != "v" {
+		t.Errorf("Get() value = %q, want %q", value, "v")
+	}
+	if !expire.Equal(wantExpire) {
+		t.Errorf("Get() expire = %v, want %v", expire, wantExpire)
+	}
+}
+
+func TestHTTPGetterGetNoExpireMeansNoExpiry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(getResponse{Value: "v"})
+	}))
+	defer srv.Close()
+
+	g := &httpGetter{baseURL: srv.URL}
+	_, expire, err := g.Get("k")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !expire.IsZero() {
+		t.Errorf("Get() expire = %v, want zero", expire)
+	}
+}
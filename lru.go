@@ -0,0 +1,212 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// entry is the value stored in each *list.Element of an lruCache.
+type entry struct {
+	key    string
+	value  string
+	expire time.Time // zero means no expiry
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+// lruCache is a byte-budget-bounded, least-recently-used cache of string
+// key/value pairs. It is not safe for concurrent use on its own; callers
+// provide their own locking (see cacheShard).
+type lruCache struct {
+	maxBytes int64 // 0 means unbounded
+	nbytes   int64
+
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newLRUCache(maxBytes int64) *lruCache {
+	return &lruCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// add inserts or updates key, evicting the least-recently-used entries
+// until the cache is back under its byte budget. Returns the keys evicted
+// as a result, if any.
+func (c *lruCache) add(key, value string, expire time.Time) (evicted []string) {
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		e := el.Value.(*entry)
+		c.nbytes += int64(len(value)) - int64(len(e.value))
+		e.value = value
+		e.expire = expire
+		return c.evictOverBudget()
+	}
+
+	e := &entry{key: key, value: value, expire: expire}
+	el := c.ll.PushFront(e)
+	c.items[key] = el
+	c.nbytes += int64(len(key)) + int64(len(value))
+	return c.evictOverBudget()
+}
+
+// get returns the value for key if present and not expired, moving it to
+// the front of the recency list. An expired entry is evicted on read.
+func (c *lruCache) get(key string, now time.Time) (string, bool) {
+	value, _, ok := c.getEntry(key, now)
+	return value, ok
+}
+
+// getEntry is like get but also returns the entry's absolute expiration
+// (zero means no expiry), for callers that need to propagate it (see
+// Cache.GetWithExpire).
+func (c *lruCache) getEntry(key string, now time.Time) (value string, expire time.Time, ok bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return "", time.Time{}, false
+	}
+	e := el.Value.(*entry)
+	if e.expired(now) {
+		c.removeElement(el)
+		return "", time.Time{}, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, e.expire, true
+}
+
+func (c *lruCache) remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// removeExpired evicts every entry whose TTL has elapsed as of now.
+func (c *lruCache) removeExpired(now time.Time) (evicted []string) {
+	for el := c.ll.Back(); el != nil; {
+		prev := el.Prev()
+		if el.Value.(*entry).expired(now) {
+			evicted = append(evicted, el.Value.(*entry).key)
+			c.removeElement(el)
+		}
+		el = prev
+	}
+	return evicted
+}
+
+func (c *lruCache) evictOverBudget() (evicted []string) {
+	for c.maxBytes > 0 && c.nbytes > c.maxBytes {
+		el := c.ll.Back()
+		if el == nil {
+			break
+		}
+		evicted = append(evicted, el.Value.(*entry).key)
+		c.removeElement(el)
+	}
+	return evicted
+}
+
+func (c *lruCache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	e := el.Value.(*entry)
+	delete(c.items, e.key)
+	c.nbytes -= int64(len(e.key)) + int64(len(e.value))
+}
+
+func (c *lruCache) len() int {
+	return c.ll.Len()
+}
+
+// cacheShard is a mutex-guarded lruCache that lazily initializes itself so
+// a zero-value cacheShard behaves as an empty, unbounded cache. evictions,
+// if set, accumulates the number of entries evicted for space (not
+// expiry) across every cacheShard that shares it.
+type cacheShard struct {
+	mu        sync.Mutex
+	maxBytes  int64
+	lru       *lruCache
+	evictions *int64
+}
+
+func (s *cacheShard) add(key, value string, expire time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		s.lru = newLRUCache(s.maxBytes)
+	}
+	evicted := s.lru.add(key, value, expire)
+	s.countEvictions(len(evicted))
+}
+
+func (s *cacheShard) get(key string, now time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		return "", false
+	}
+	return s.lru.get(key, now)
+}
+
+func (s *cacheShard) getEntry(key string, now time.Time) (value string, expire time.Time, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		return "", time.Time{}, false
+	}
+	return s.lru.getEntry(key, now)
+}
+
+func (s *cacheShard) remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru != nil {
+		s.lru.remove(key)
+	}
+}
+
+func (s *cacheShard) removeExpired(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru != nil {
+		s.lru.removeExpired(now)
+	}
+}
+
+func (s *cacheShard) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		return 0
+	}
+	return s.lru.len()
+}
+
+// snapshot returns a copy of every live (non-expired) key/value pair, for
+// debugging/inspection endpoints.
+func (s *cacheShard) snapshot(now time.Time) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lru == nil {
+		return nil
+	}
+	out := make(map[string]string, s.lru.len())
+	for el := s.lru.ll.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry)
+		if !e.expired(now) {
+			out[e.key] = e.value
+		}
+	}
+	return out
+}
+
+func (s *cacheShard) countEvictions(n int) {
+	if n > 0 && s.evictions != nil {
+		atomic.AddInt64(s.evictions, int64(n))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEvictsOverBudget(t *testing.T) {
+	// Budget only large enough for two "k=v" sized entries (1+1 bytes each).
+	c := newLRUCache(4)
+
+	c.add("a", "1", time.Time{})
+	c.add("b", "2", time.Time{})
+	c.add("c", "2", time.Time{}) // should evict "a", the least-recently-used
+
+	if _, ok := c.get("a", time.Now()); ok {
+		t.Errorf("get(%q) after eviction: ok = true, want false", "a")
+	}
+	if _, ok := c.get("b", time.Now()); !ok {
+		t.Errorf("get(%q): ok = false, want true", "b")
+	}
+	if _, ok := c.get("c", time.Now()); !ok {
+		t.Errorf("get(%q): ok = false, want true", "c")
+	}
+}
+
+func TestLRUCacheRemoveExpired(t *testing.T) {
+	c := newLRUCache(0)
+	now := time.Now()
+
+	c.add("stale", "v", now.Add(-time.Second))
+	c.add("fresh", "v", now.Add(time.Hour))
+
+	evicted := c.removeExpired(now)
+	if len(evicted) != 1 || evicted[0] != "stale" {
+		t.Errorf("removeExpired = %v, want [stale]", evicted)
+	}
+	if _, ok := c.get("fresh", now); !ok {
+		t.Errorf("get(%q): ok = false, want true", "fresh")
+	}
+}
@@ -3,200 +3,389 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
-// Cache represents a replicated memory cache.
-type Cache struct {
-	data  sync.Map   // Concurrent map to store data
-	peers []string   // List of peer servers
-	mu    sync.Mutex // Mutex for synchronizing access to the cache
+// defaultHotCacheFraction is the fraction of a Cache's byte budget set
+// aside for the hot cache, mirroring groupcache.
+const defaultHotCacheFraction = 8
+
+// Stats holds point-in-time cache counters, safe to read concurrently via
+// Cache.Stats.
+type Stats struct {
+	Gets      int64 // calls to Get
+	Hits      int64 // Gets found locally or via a peer
+	LocalHits int64 // Gets served from main or hot cache without a peer round trip
+	PeerLoads int64 // Gets that required fetching from the owning peer
+	Evictions int64 // entries evicted from main or hot cache for space
 }
 
-// Add adds a new key-value pair to the cache and replicates it to peer servers.
-func (c *Cache) Add(server string, key, value string) {
-	c.mu.Lock() // Lock to ensure atomicity
-	defer c.mu.Unlock()
+// Cache represents a single node in a sharded cache cluster. Each key is
+// owned by exactly one node, chosen by peers; Add/Set/Delete forward to
+// the owner when it isn't self. Locally owned entries live in main; values
+// fetched from peers are cached in hot so repeated lookups avoid another
+// round trip.
+type Cache struct {
+	self string // this node's own address, as known to peers
 
-	c.data.Store(key, value)            // Store data in cache
-	c.replicateData(server, key, value) // Replicate data to peer servers
-}
+	peers PeerPicker // locates the owner of a key; nil means self owns everything
 
-// Get retrieves the value associated with the given key from the cache.
-func (c *Cache) Get(server string, key string) (string, bool) {
-	val, ok := c.data.Load(key)
-	if !ok {
-		return "", false
-	}
-	return val.(string), true
-}
+	main cacheShard // keys owned by this node
+	hot  cacheShard // keys owned by peers, populated by remote Gets
+
+	janitorStop chan struct{}
 
-// Delete removes the key-value pair associated with the given key from the cache.
-func (c *Cache) Delete(server string, key string) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	stats Stats
 
-	c.data.Delete(key)             // Delete data from cache
-	c.replicateDelete(server, key) // Replicate deletion to peer servers
+	loadGroup   group // coalesces concurrent Set calls for the same key (see Set's doc comment on its write semantics)
+	removeGroup group // suppresses duplicate concurrent Delete calls for the same key
+
+	events *eventBus // publishes set/delete mutations to /updates subscribers
 }
 
-// replicateData replicates the newly added data to all peer servers.
-func (c *Cache) replicateData(server string, key, value string) {
-	for _, peer := range c.peers {
-		go func(peerAddr string) {
-			_, err := http.Post(peerAddr+"/replicate", "application/json", bytes.NewBuffer([]byte(key+"="+value)))
-			if err != nil {
-				log.Printf("\033[31mError replicating data to %s: %v\033[0m", peerAddr, err)
-			} else {
-				log.Printf("\033[32mReplicated data to %s\033[0m", peerAddr)
-			}
-		}(peer)
-	}
+// NewCache creates a Cache for the node at self, owning keys per peers.
+// maxBytes bounds the main cache (locally owned keys); the hot cache
+// (values fetched from peers) is capped at maxBytes/defaultHotCacheFraction.
+// A maxBytes of 0 means unbounded.
+func NewCache(self string, peers PeerPicker, maxBytes int64) *Cache {
+	c := &Cache{self: self, peers: peers}
+	c.main = cacheShard{maxBytes: maxBytes, evictions: &c.stats.Evictions}
+	c.hot = cacheShard{maxBytes: maxBytes / defaultHotCacheFraction, evictions: &c.stats.Evictions}
+	c.events = newEventBus()
+	return c
 }
 
-// replicateDelete replicates the deletion of data to all peer servers.
-func (c *Cache) replicateDelete(server string, key string) {
-	for _, peer := range c.peers {
-		go func(peerAddr string) {
-			req, err := http.NewRequest("DELETE", peerAddr+"/replicate/"+key, nil)
-			if err != nil {
-				log.Printf("\033[31mError creating delete request to %s: %v\033[0m", peerAddr, err)
+// StartJanitor launches a background goroutine that sweeps expired entries
+// from the main and hot caches every interval. It is safe to call at most
+// once per Cache; call Close to stop it.
+func (c *Cache) StartJanitor(interval time.Duration) {
+	c.janitorStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				now := time.Now()
+				c.main.removeExpired(now)
+				c.hot.removeExpired(now)
+			case <-c.janitorStop:
 				return
 			}
-			_, err = http.DefaultClient.Do(req)
-			if err != nil {
-				log.Printf("\033[31mError replicating delete to %s: %v\033[0m", peerAddr, err)
-			} else {
-				log.Printf("\033[33mReplicated delete to %s\033[0m", peerAddr)
-			}
-		}(peer)
+		}
+	}()
+}
+
+// Close stops the background janitor goroutine, if one was started.
+func (c *Cache) Close() {
+	if c.janitorStop != nil {
+		close(c.janitorStop)
 	}
 }
 
-// getDataFromCache retrieves all key-value pairs from the cache and formats them as a string.
-func (c *Cache) getDataFromCache(server string) string {
-	var buf bytes.Buffer
-	c.data.Range(func(key, value interface{}) bool {
-		buf.WriteString(fmt.Sprintf("%s=%s\n", key, value)) // Format key-value pair
-		return true
-	})
-	log.Printf("\033[36mRetrieved cache content on %s\033[0m", server)
-	return buf.String()
+// Stats returns a snapshot of the cache's counters.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Gets:      atomic.LoadInt64(&c.stats.Gets),
+		Hits:      atomic.LoadInt64(&c.stats.Hits),
+		LocalHits: atomic.LoadInt64(&c.stats.LocalHits),
+		PeerLoads: atomic.LoadInt64(&c.stats.PeerLoads),
+		Evictions: atomic.LoadInt64(&c.stats.Evictions),
+	}
 }
 
-func main() {
-	cache := &Cache{
-		peers: []string{"http://localhost:8081", "http://localhost:8082"}, // Example peer addresses
+// pickPeer returns the Peer owning key, or (nil, false) if self owns it.
+// A nil PeerPicker (e.g. in tests) means every key is owned locally.
+func (c *Cache) pickPeer(key string) (Peer, bool) {
+	if c.peers == nil {
+		return nil, false
 	}
+	return c.peers.PickPeer(key)
+}
 
-	// Handler for adding data to the cache
-	http.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
-		key := r.URL.Query().Get("key")
-		value := r.URL.Query().Get("value")
-		if key == "" || value == "" {
-			http.Error(w, "key and value are required", http.StatusBadRequest)
-			return
+// Add stores a key-value pair with no expiry. It is a convenience wrapper
+// over Set.
+func (c *Cache) Add(key, value string) error {
+	return c.Set(key, value, 0)
+}
+
+// Set stores a key-value pair with the given ttl (0 means no expiry). If
+// key is owned by a remote peer the write is forwarded to its owner
+// instead of being stored locally.
+//
+// Concurrent Sets for the same key are coalesced via loadGroup: only one
+// of them actually runs, and every caller gets that one's result. This is
+// safe for deduplicating redundant retries of an identical write, but it
+// means the *value* written when two concurrent Sets for the same key
+// disagree (e.g. Set(k,"A") racing Set(k,"B")) is whichever call loadGroup
+// happens to pick as the leader, not necessarily the one that was called
+// last. Callers that need a real last-writer-wins guarantee for a given
+// key must serialize their own Sets for it.
+func (c *Cache) Set(key, value string, ttl time.Duration) error {
+	_, err := c.loadGroup.Do(key, func() (interface{}, error) {
+		if peer, ok := c.pickPeer(key); ok {
+			return nil, peer.Add(key, value, ttl)
 		}
-		cache.Add("http://localhost:8080", key, value) // Adding data to the cache
-		log.Printf("\033[32mAdded key-value pair: %s=%s on http://localhost:8080\033[0m", key, value)
-		w.WriteHeader(http.StatusOK)
+
+		c.setLocal(key, value, ttl)
+		return nil, nil
 	})
+	return err
+}
 
-	// Handler for retrieving data from the cache
-	http.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
-		key := r.URL.Query().Get("key")
-		if key == "" {
-			http.Error(w, "key is required", http.StatusBadRequest)
-			return
+// setLocal stores key/value/ttl in the main cache without consulting the
+// PeerPicker, for callers (such as the /replicate handler) that already
+// know this node is the intended owner.
+func (c *Cache) setLocal(key, value string, ttl time.Duration) {
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	c.main.add(key, value, expire)
+
+	var expireNanos int64
+	if !expire.IsZero() {
+		expireNanos = expire.UnixNano()
+	}
+	c.events.publish(Event{Op: opSet, Key: key, Value: value, Expire: expireNanos})
+}
+
+// maxHotEntryTTL bounds how long a value fetched from a peer is kept in
+// the hot cache, even if the owner set no TTL or a longer one. Since a
+// Set or Delete on the owner isn't propagated to peers' hot caches, this
+// bounds how long a peer can keep serving a value the owner has since
+// overwritten or deleted.
+const maxHotEntryTTL = 30 * time.Second
+
+// Get retrieves the value for key. It is a convenience wrapper over
+// GetWithExpire for callers that don't need the expiration.
+func (c *Cache) Get(key string) (string, bool) {
+	val, _, ok := c.GetWithExpire(key)
+	return val, ok
+}
+
+// GetWithExpire retrieves the value and absolute expiration (zero means
+// no expiry) for key, checking the local main and hot caches before
+// consulting the owning peer. A value fetched from a peer is cached in
+// hot, capped at maxHotEntryTTL, so repeated lookups don't pay another
+// round trip while still bounding how stale a peer-served value can get.
+func (c *Cache) GetWithExpire(key string) (value string, expire time.Time, ok bool) {
+	atomic.AddInt64(&c.stats.Gets, 1)
+	now := time.Now()
+
+	if val, exp, ok := c.main.getEntry(key, now); ok {
+		atomic.AddInt64(&c.stats.Hits, 1)
+		atomic.AddInt64(&c.stats.LocalHits, 1)
+		return val, exp, true
+	}
+	if val, exp, ok := c.hot.getEntry(key, now); ok {
+		atomic.AddInt64(&c.stats.Hits, 1)
+		atomic.AddInt64(&c.stats.LocalHits, 1)
+		return val, exp, true
+	}
+
+	if peer, ok := c.pickPeer(key); ok {
+		val, exp, err := peer.Get(key)
+		if err != nil {
+			if !errors.Is(err, errKeyNotFound) {
+				log.Printf("\033[31mError fetching %s from owning peer: %v\033[0m", key, err)
+			}
+			return "", time.Time{}, false
 		}
-		val, ok := cache.Get("http://localhost:8080", key)
-		if !ok {
-			http.Error(w, "key not found", http.StatusNotFound)
-			return
+		atomic.AddInt64(&c.stats.Hits, 1)
+		atomic.AddInt64(&c.stats.PeerLoads, 1)
+
+		hotExpire := now.Add(maxHotEntryTTL)
+		if !exp.IsZero() && exp.Before(hotExpire) {
+			hotExpire = exp
 		}
-		log.Printf("\033[36mRetrieved value for key %s: %s on http://localhost:8080\033[0m", key, val)
-		json.NewEncoder(w).Encode(map[string]string{key: val})
-	})
+		c.hot.add(key, val, hotExpire)
+		return val, exp, true
+	}
 
-	// Handler for deleting data from the cache
-	http.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
-		key := r.URL.Query().Get("key")
-		if key == "" {
-			http.Error(w, "key is required", http.StatusBadRequest)
-			return
+	return "", time.Time{}, false
+}
+
+// Delete removes key. If key is owned by a remote peer the deletion is
+// forwarded to its owner instead of being applied locally. Concurrent
+// Deletes for the same key are coalesced via removeGroup.
+func (c *Cache) Delete(key string) error {
+	_, err := c.removeGroup.Do(key, func() (interface{}, error) {
+		if peer, ok := c.pickPeer(key); ok {
+			return nil, peer.Delete(key)
 		}
-		cache.Delete("http://localhost:8080", key)
-		log.Printf("\033[33mDeleted key %s on http://localhost:8080\033[0m", key)
-		w.WriteHeader(http.StatusOK)
+
+		c.deleteLocal(key)
+		return nil, nil
 	})
+	return err
+}
+
+// deleteLocal removes key from the main and hot caches without
+// consulting the PeerPicker, for callers (such as the /replicate
+// handler) that already know this node is the intended owner.
+func (c *Cache) deleteLocal(key string) {
+	c.main.remove(key)
+	c.hot.remove(key)
+	c.events.publish(Event{Op: opDelete, Key: key})
+}
+
+// Subscribe registers for future cache mutation Events, returning a
+// buffered channel and an unsubscribe func the caller must invoke exactly
+// once (typically via defer) to release it.
+func (c *Cache) Subscribe() (<-chan Event, func()) {
+	return c.events.Subscribe()
+}
+
+// eventsSince returns every retained Event after lastID, for Last-Event-ID
+// reconnect catch-up; ok is false if lastID is older than the retained
+// history.
+func (c *Cache) eventsSince(lastID int64) (events []Event, ok bool) {
+	return c.events.since(lastID)
+}
 
-	// Handler for replicating data from other servers
-	http.HandleFunc("/replicate", func(w http.ResponseWriter, r *http.Request) {
-		var data map[string]string
-		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-			http.Error(w, "invalid request body", http.StatusBadRequest)
+// getDataFromCache formats every locally owned key-value pair as "key=value" lines.
+func (c *Cache) getDataFromCache() string {
+	var buf bytes.Buffer
+	for key, value := range c.main.snapshot(time.Now()) {
+		buf.WriteString(fmt.Sprintf("%s=%s\n", key, value))
+	}
+	return buf.String()
+}
+
+// parseTTL reads an optional relative "ttl" in seconds off the request,
+// as used by external clients calling /add directly. No "ttl" means no
+// expiry. Peer-to-peer writes carry their own absolute expiration in a
+// ReplicationOp instead (see /replicate).
+func parseTTL(r *http.Request) (time.Duration, error) {
+	v := r.URL.Query().Get("ttl")
+	if v == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// sseHeartbeatInterval is how often a comment-only SSE line is sent on an
+// otherwise idle /updates connection, keeping it (and any proxies in
+// between) from timing it out.
+const sseHeartbeatInterval = 15 * time.Second
+
+// sseEventName maps an Event's Op to the SSE "event:" field: "set" and
+// "del" for cache mutations, or the Op verbatim for anything else (e.g.
+// "overflow").
+func sseEventName(op string) string {
+	switch op {
+	case opSet:
+		return "set"
+	case opDelete:
+		return "del"
+	default:
+		return op
+	}
+}
+
+// writeSSEEvent writes ev as a single SSE message: an id line (for
+// Last-Event-ID catch-up on reconnect), an event line, and a JSON data
+// line.
+func writeSSEEvent(w http.ResponseWriter, ev Event) {
+	body, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, sseEventName(ev.Op), body)
+}
+
+// sseHandler returns the /updates handler: it streams cache.Subscribe()
+// as Server-Sent Events, replaying any events after a client-supplied
+// Last-Event-ID, and sends a periodic heartbeat to keep idle connections
+// alive.
+func sseHandler(cache *Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
 			return
 		}
-		for key, value := range data {
-			cache.Add(r.Host, key, value) // Add replicated data to cache
-		}
-		log.Printf("\033[35mReplicated data from peer server on %s\033[0m", r.Host)
-		w.WriteHeader(http.StatusOK)
-	})
 
-	// Handler for retrieving cache content
-	http.HandleFunc("/getCacheContent", func(w http.ResponseWriter, r *http.Request) {
-		content := cache.getDataFromCache(r.Host)
-		fmt.Fprintf(w, "%s", content)
-	})
-
-	// Handler for SSE updates
-	http.HandleFunc("/updates", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
 
-		// Create a channel to send updates to clients
-		updates := make(chan string)
-
-		// Start a goroutine to listen for cache updates and send them to clients
-		go func() {
-			for {
-				// Retrieve data from the cache and send it to clients
-				data := cache.getDataFromCache(r.Host)
-				updates <- data
+		events, unsubscribe := cache.Subscribe()
+		defer unsubscribe()
 
-				// Wait for a short duration before sending the next update
-				time.Sleep(1 * time.Second)
+		if lastID, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+			if missed, ok := cache.eventsSince(lastID); ok {
+				for _, ev := range missed {
+					writeSSEEvent(w, ev)
+				}
+				flusher.Flush()
 			}
-		}()
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
 
-		// Continuously send updates to clients
 		for {
 			select {
-			case update := <-updates:
-				fmt.Fprintf(w, "data: %s\n\n", update) // Send update as SSE message
-				w.(http.Flusher).Flush()               // Flush the response writer to ensure the message is sent immediately
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				writeSSEEvent(w, ev)
+				flusher.Flush()
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+				flusher.Flush()
 			case <-r.Context().Done():
 				return
 			}
 		}
-	})
+	}
+}
 
-	// ListenAndServe on multiple ports
-	go func() {
-		log.Fatal(http.ListenAndServe(":8080", nil))
-	}()
-	go func() {
-		log.Fatal(http.ListenAndServe(":8081", nil))
-	}()
-	go func() {
-		log.Fatal(http.ListenAndServe(":8082", nil))
-	}()
+// defaultMaxBytes bounds the main cache's byte usage (len(key)+len(value)
+// summed over its entries); the hot cache gets 1/defaultHotCacheFraction
+// of this budget.
+const defaultMaxBytes = 1 << 20 // 1MB
+
+// defaultJanitorInterval is how often expired entries are swept in the
+// background.
+const defaultJanitorInterval = 30 * time.Second
+
+func main() {
+	addrs := []string{
+		"http://localhost:8080",
+		"http://localhost:8081",
+		"http://localhost:8082",
+	}
+
+	// No peer public keys are configured by default, so incoming
+	// replication ops are accepted unsigned; operators running across an
+	// untrusted network should pass WithVerifier and WithSigner to
+	// NewServer instead.
+	servers := make([]*Server, len(addrs))
+	for i, self := range addrs {
+		peers := make([]string, 0, len(addrs)-1)
+		peers = append(peers, addrs[:i]...)
+		peers = append(peers, addrs[i+1:]...)
+		servers[i] = NewServer(self, peers)
+	}
+
+	for _, s := range servers {
+		s := s
+		go func() {
+			log.Fatal(s.ListenAndServe())
+		}()
+	}
 
 	select {}
 }
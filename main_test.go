@@ -3,22 +3,22 @@ package main
 import (
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestAdd(t *testing.T) {
 	// Set up a test cache instance
-	cache := &Cache{
-		data:  sync.Map{},
-		peers: []string{"http://localhost:8081", "http://localhost:8082"},
-	}
+	cache := &Cache{}
 
 	// Call the Add function with test data
 	key := "testKey"
 	value := "testValue"
-	cache.Add("http://localhost:8080", key, value)
+	if err := cache.Add(key, value); err != nil {
+		t.Fatalf("Add returned unexpected error: %v", err)
+	}
 
 	// Retrieve the value using Get function
-	val, ok := cache.Get("http://localhost:8080", key)
+	val, ok := cache.Get(key)
 
 	// Check if the value was added successfully
 	if !ok || val != value {
@@ -28,18 +28,15 @@ func TestAdd(t *testing.T) {
 
 func TestGet(t *testing.T) {
 	// Set up a test cache instance with some initial data
-	cache := &Cache{
-		data:  sync.Map{},
-		peers: []string{"http://localhost:8081", "http://localhost:8082"},
-	}
+	cache := &Cache{}
 
 	// Add test data to the cache
-	cache.data.Store("testKey", "testValue")
+	cache.main.add("testKey", "testValue", time.Time{})
 
 	// Call the Get function to retrieve the value
 	key := "testKey"
 	expectedValue := "testValue"
-	actualValue, ok := cache.Get("http://localhost:8080", key)
+	actualValue, ok := cache.Get(key)
 
 	// Check if the value was retrieved successfully
 	if !ok || actualValue != expectedValue {
@@ -49,23 +46,87 @@ func TestGet(t *testing.T) {
 
 func TestDelete(t *testing.T) {
 	// Set up a test cache instance with some initial data
-	cache := &Cache{
-		data:  sync.Map{},
-		peers: []string{"http://localhost:8081", "http://localhost:8082"},
-	}
+	cache := &Cache{}
 
 	// Add test data to the cache
-	cache.data.Store("testKey", "testValue")
+	cache.main.add("testKey", "testValue", time.Time{})
 
 	// Call the Delete function to remove the data
 	key := "testKey"
-	cache.Delete("http://localhost:8080", key)
+	if err := cache.Delete(key); err != nil {
+		t.Fatalf("Delete returned unexpected error: %v", err)
+	}
 
 	// Attempt to retrieve the deleted value
-	_, ok := cache.Get("http://localhost:8080", key)
+	_, ok := cache.Get(key)
 
 	// Check if the value was deleted successfully
 	if ok {
 		t.Errorf("Delete function failed. Value still exists for key: %s", key)
 	}
 }
+
+func TestDeleteCoalescesConcurrentCalls(t *testing.T) {
+	// Concurrent deletes for the same key should coalesce into a single
+	// removeGroup call rather than racing independent local deletes.
+	cache := &Cache{}
+	cache.main.add("testKey", "testValue", time.Time{})
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = cache.Delete("testKey")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Delete call %d returned unexpected error: %v", i, err)
+		}
+	}
+
+	if _, ok := cache.Get("testKey"); ok {
+		t.Errorf("Delete function failed. Value still exists for key: testKey")
+	}
+}
+
+func TestSetTTLExpires(t *testing.T) {
+	cache := &Cache{}
+
+	if err := cache.Set("testKey", "testValue", time.Millisecond); err != nil {
+		t.Fatalf("Set returned unexpected error: %v", err)
+	}
+	if _, ok := cache.Get("testKey"); !ok {
+		t.Fatalf("Get immediately after Set: ok = false, want true")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := cache.Get("testKey"); ok {
+		t.Errorf("Get after ttl elapsed: ok = true, want false (lazy expiry on read)")
+	}
+}
+
+func TestStatsTracksHitsAndGets(t *testing.T) {
+	cache := &Cache{}
+	cache.main.add("testKey", "testValue", time.Time{})
+
+	cache.Get("testKey")
+	cache.Get("missingKey")
+
+	stats := cache.Stats()
+	if stats.Gets != 2 {
+		t.Errorf("Stats().Gets = %d, want 2", stats.Gets)
+	}
+	if stats.Hits != 1 {
+		t.Errorf("Stats().Hits = %d, want 1", stats.Hits)
+	}
+	if stats.LocalHits != 1 {
+		t.Errorf("Stats().LocalHits = %d, want 1", stats.LocalHits)
+	}
+}
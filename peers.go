@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// errKeyNotFound is returned by a Peer when the requested key does not
+// exist on that peer.
+var errKeyNotFound = errors.New("key not found")
+
+// Peer is a remote cache node that can serve requests for keys it owns.
+type Peer interface {
+	// Get returns the value for key and its absolute expiration (zero
+	// means no expiry), so a caller caching the result locally (see
+	// Cache.hot) can honor the owner's TTL instead of caching forever.
+	Get(key string) (value string, expire time.Time, err error)
+	Add(key, value string, ttl time.Duration) error
+	Delete(key string) error
+}
+
+// PeerPicker locates the Peer responsible for a given key. Implementations
+// return (nil, false) when the key is owned by the local node.
+type PeerPicker interface {
+	PickPeer(key string) (peer Peer, ok bool)
+}
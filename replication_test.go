@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+func TestVerifierAcceptsValidSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer := &Signer{Origin: "http://peer", PrivateKey: priv}
+	verifier := NewVerifier(map[string]ed25519.PublicKey{"http://peer": pub})
+
+	now := time.Now()
+	op, err := signer.sign(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, now)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := verifier.Verify(op, now); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+}
+
+func TestVerifierRejectsTamperedValue(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer := &Signer{Origin: "http://peer", PrivateKey: priv}
+	verifier := NewVerifier(map[string]ed25519.PublicKey{"http://peer": pub})
+
+	now := time.Now()
+	op, err := signer.sign(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, now)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	op.Value = "tampered"
+
+	if err := verifier.Verify(op, now); err != errBadSignature {
+		t.Errorf("Verify() = %v, want errBadSignature", err)
+	}
+}
+
+func TestVerifierRejectsStaleTimestamp(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer := &Signer{Origin: "http://peer", PrivateKey: priv}
+	verifier := NewVerifier(map[string]ed25519.PublicKey{"http://peer": pub})
+
+	signedAt := time.Now().Add(-time.Hour)
+	op, err := signer.sign(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, signedAt)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := verifier.Verify(op, time.Now()); err != errStaleOp {
+		t.Errorf("Verify() = %v, want errStaleOp", err)
+	}
+}
+
+func TestVerifierRejectsReplayedNonce(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer := &Signer{Origin: "http://peer", PrivateKey: priv}
+	verifier := NewVerifier(map[string]ed25519.PublicKey{"http://peer": pub})
+
+	now := time.Now()
+	op, err := signer.sign(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, now)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := verifier.Verify(op, now); err != nil {
+		t.Fatalf("first Verify() = %v, want nil", err)
+	}
+	if err := verifier.Verify(op, now); err != errReplayedOp {
+		t.Errorf("replayed Verify() = %v, want errReplayedOp", err)
+	}
+}
+
+func TestVerifierRejectsUnknownOrigin(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer := &Signer{Origin: "http://stranger", PrivateKey: priv}
+	verifier := NewVerifier(map[string]ed25519.PublicKey{"http://peer": make(ed25519.PublicKey, ed25519.PublicKeySize)})
+
+	now := time.Now()
+	op, err := signer.sign(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, now)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if err := verifier.Verify(op, now); err != errUnknownPeer {
+		t.Errorf("Verify() = %v, want errUnknownPeer", err)
+	}
+}
+
+func TestVerifierAcceptsUnsignedWhenUnconfigured(t *testing.T) {
+	verifier := NewVerifier(nil)
+	if err := verifier.Verify(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, time.Now()); err != nil {
+		t.Errorf("Verify() with no configured peer keys = %v, want nil", err)
+	}
+}
+
+func TestVerifierJanitorSweepsExpiredNonces(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer := &Signer{Origin: "http://peer", PrivateKey: priv}
+	verifier := NewVerifier(map[string]ed25519.PublicKey{"http://peer": pub})
+
+	verifier.StartJanitor(time.Millisecond)
+	defer verifier.Close()
+
+	signedAt := time.Now().Add(-nonceTTL - time.Second)
+	op, err := signer.sign(ReplicationOp{Op: opSet, Key: "k", Value: "v"}, signedAt)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	verifier.mu.Lock()
+	verifier.seen.add(op.Nonce, "", signedAt.Add(nonceTTL))
+	before := verifier.seen.len()
+	verifier.mu.Unlock()
+	if before != 1 {
+		t.Fatalf("seen.len() before sweep = %d, want 1", before)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		verifier.mu.Lock()
+		n := verifier.seen.len()
+		verifier.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("janitor did not sweep the expired nonce within 1s")
+}
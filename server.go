@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// serverConfig holds the options NewServer assembles before constructing
+// a Server's Cache and HTTPPool. Populated by Option funcs.
+type serverConfig struct {
+	maxBytes        int64
+	janitorInterval time.Duration
+	defaultTTL      time.Duration
+	transport       http.RoundTripper
+	logger          *log.Logger
+	peers           PeerPicker
+	verifier        *Verifier
+	signer          *Signer
+}
+
+// Option configures a Server built by NewServer.
+type Option func(*serverConfig)
+
+// WithMaxBytes bounds the Server's main cache (see NewCache).
+func WithMaxBytes(n int64) Option {
+	return func(c *serverConfig) { c.maxBytes = n }
+}
+
+// WithJanitorInterval overrides how often expired entries are swept in
+// the background (see Cache.StartJanitor).
+func WithJanitorInterval(d time.Duration) Option {
+	return func(c *serverConfig) { c.janitorInterval = d }
+}
+
+// WithDefaultTTL sets the ttl applied to /add requests that don't specify
+// one of their own.
+func WithDefaultTTL(d time.Duration) Option {
+	return func(c *serverConfig) { c.defaultTTL = d }
+}
+
+// WithTransport sets the http.RoundTripper used for outgoing peer
+// requests, e.g. to share a connection pool across Servers.
+func WithTransport(t http.RoundTripper) Option {
+	return func(c *serverConfig) { c.transport = t }
+}
+
+// WithLogger overrides the *log.Logger a Server writes request logs to.
+// The default is log.Default().
+func WithLogger(l *log.Logger) Option {
+	return func(c *serverConfig) { c.logger = l }
+}
+
+// WithPeerPicker overrides the default HTTPPool-backed PeerPicker, e.g.
+// to stub out peer resolution in tests.
+func WithPeerPicker(p PeerPicker) Option {
+	return func(c *serverConfig) { c.peers = p }
+}
+
+// WithVerifier overrides the default unsigned Verifier, for operators
+// running replication across an untrusted network.
+func WithVerifier(v *Verifier) Option {
+	return func(c *serverConfig) { c.verifier = v }
+}
+
+// WithSigner configures outgoing replication ops to be signed with s,
+// for operators running replication across an untrusted network.
+func WithSigner(s *Signer) Option {
+	return func(c *serverConfig) { c.signer = s }
+}
+
+// Server bundles a Cache with its own http.ServeMux, so that several
+// Servers can run in one process (see Cluster) without colliding on
+// http.DefaultServeMux.
+type Server struct {
+	self string
+
+	cache        *Cache
+	pool         *HTTPPool // nil when constructed with WithPeerPicker
+	verifier     *Verifier
+	ownsVerifier bool // true if NewServer created verifier and owns its janitor
+	logger       *log.Logger
+
+	defaultTTL time.Duration
+
+	mux *http.ServeMux
+}
+
+// NewServer creates a Server for the node at self, peered with the given
+// peer addresses. self and peers are the addresses peers use to reach
+// each other (e.g. "http://localhost:8080"), not necessarily the address
+// passed to ListenAndServe/Serve.
+func NewServer(self string, peers []string, opts ...Option) *Server {
+	cfg := serverConfig{
+		maxBytes:        defaultMaxBytes,
+		janitorInterval: defaultJanitorInterval,
+		logger:          log.Default(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	picker := cfg.peers
+	var pool *HTTPPool
+	if picker == nil {
+		pool = NewHTTPPool(self, peers...)
+		if cfg.transport != nil {
+			pool.SetTransport(cfg.transport)
+		}
+		if cfg.signer != nil {
+			pool.SetSigner(cfg.signer)
+		}
+		picker = pool
+	}
+
+	cache := NewCache(self, picker, cfg.maxBytes)
+	cache.StartJanitor(cfg.janitorInterval)
+
+	verifier := cfg.verifier
+	ownsVerifier := verifier == nil
+	if ownsVerifier {
+		verifier = NewVerifier(nil)
+		verifier.StartJanitor(cfg.janitorInterval)
+	}
+
+	s := &Server{
+		self:         self,
+		cache:        cache,
+		pool:         pool,
+		verifier:     verifier,
+		ownsVerifier: ownsVerifier,
+		logger:       cfg.logger,
+		defaultTTL:   cfg.defaultTTL,
+	}
+	s.mux = s.buildMux()
+	return s
+}
+
+// Cache returns the Server's underlying Cache.
+func (s *Server) Cache() *Cache {
+	return s.cache
+}
+
+// Close stops the Server's background janitor goroutines.
+func (s *Server) Close() {
+	s.cache.Close()
+	if s.ownsVerifier {
+		s.verifier.Close()
+	}
+}
+
+// Serve accepts connections on l, dispatching to this Server's own mux,
+// until l is closed.
+func (s *Server) Serve(l net.Listener) error {
+	return http.Serve(l, s.mux)
+}
+
+// ListenAndServe listens on the host:port portion of s.self and serves
+// until the listener fails.
+func (s *Server) ListenAndServe() error {
+	u, err := url.Parse(s.self)
+	if err != nil {
+		return fmt.Errorf("parsing self address %q: %w", s.self, err)
+	}
+	l, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// buildMux registers this Server's handlers, each closing over its own
+// Cache/verifier/logger rather than package-level globals, on a fresh
+// ServeMux.
+func (s *Server) buildMux() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Handler for adding data to the cache
+	mux.HandleFunc("/add", func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		value := r.URL.Query().Get("value")
+		if key == "" || value == "" {
+			http.Error(w, "key and value are required", http.StatusBadRequest)
+			return
+		}
+		ttl, err := parseTTL(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if ttl == 0 {
+			ttl = s.defaultTTL
+		}
+		if err := s.cache.Set(key, value, ttl); err != nil {
+			s.logger.Printf("\033[31mAdd failed for %s=%s: %v\033[0m", key, value, err)
+			http.Error(w, "replication to one or more peers failed", http.StatusBadGateway)
+			return
+		}
+		s.logger.Printf("\033[32mAdded key-value pair: %s=%s on %s\033[0m", key, value, s.self)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Handler for retrieving data from the cache
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		val, expire, ok := s.cache.GetWithExpire(key)
+		if !ok {
+			http.Error(w, "key not found", http.StatusNotFound)
+			return
+		}
+		s.logger.Printf("\033[36mRetrieved value for key %s: %s on %s\033[0m", key, val, s.self)
+		resp := getResponse{Value: val}
+		if !expire.IsZero() {
+			resp.Expire = expire.UnixNano()
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+
+	// Handler for deleting data from the cache
+	mux.HandleFunc("/delete", func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Query().Get("key")
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		if err := s.cache.Delete(key); err != nil {
+			s.logger.Printf("\033[31mDelete failed for %s: %v\033[0m", key, err)
+			http.Error(w, "replication to one or more peers failed", http.StatusBadGateway)
+			return
+		}
+		s.logger.Printf("\033[33mDeleted key %s on %s\033[0m", key, s.self)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Handler applying a signed ReplicationOp (set or delete) forwarded
+	// by the peer that owns this key.
+	mux.HandleFunc("/replicate", func(w http.ResponseWriter, r *http.Request) {
+		var op ReplicationOp
+		if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := s.verifier.Verify(op, time.Now()); err != nil {
+			s.logger.Printf("\033[31mRejected replication op for %s from %s: %v\033[0m", op.Key, op.Origin, err)
+			http.Error(w, "replication verification failed", http.StatusUnauthorized)
+			return
+		}
+
+		switch op.Op {
+		case opSet:
+			var ttl time.Duration
+			if op.Expire > 0 {
+				ttl = time.Until(time.Unix(0, op.Expire))
+			}
+			s.cache.setLocal(op.Key, op.Value, ttl)
+		case opDelete:
+			s.cache.deleteLocal(op.Key)
+		default:
+			http.Error(w, "unknown op", http.StatusBadRequest)
+			return
+		}
+		s.logger.Printf("\033[35mApplied replicated %s for %s from %s\033[0m", op.Op, op.Key, r.Host)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Handler for inspecting cache hit/miss/eviction counters.
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(s.cache.Stats())
+	})
+
+	// Handler for retrieving cache content
+	mux.HandleFunc("/getCacheContent", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s", s.cache.getDataFromCache())
+	})
+
+	// Handler for SSE updates
+	mux.HandleFunc("/updates", sseHandler(s.cache))
+
+	return mux
+}
+
+// Cluster runs several in-process Servers, each on its own ephemeral
+// localhost port and wired as every other's peer, for tests and local
+// demos that need real owner-forwarding over HTTP without hardcoding
+// ports.
+type Cluster struct {
+	Servers   []*Server
+	listeners []net.Listener
+}
+
+// NewCluster starts n Servers, each bound to an ephemeral localhost port
+// and peered with the others, and begins serving in background
+// goroutines. Call Close when done to stop them.
+func NewCluster(n int, opts ...Option) (*Cluster, error) {
+	listeners := make([]net.Listener, n)
+	addrs := make([]string, n)
+	for i := range listeners {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, fmt.Errorf("listening for cluster node %d: %w", i, err)
+		}
+		listeners[i] = l
+		addrs[i] = "http://" + l.Addr().String()
+	}
+
+	servers := make([]*Server, n)
+	for i, self := range addrs {
+		peers := make([]string, 0, n-1)
+		for j, addr := range addrs {
+			if j != i {
+				peers = append(peers, addr)
+			}
+		}
+		servers[i] = NewServer(self, peers, opts...)
+	}
+
+	for i, s := range servers {
+		go s.Serve(listeners[i])
+	}
+
+	return &Cluster{Servers: servers, listeners: listeners}, nil
+}
+
+// Close stops every node's listener and background janitor.
+func (c *Cluster) Close() {
+	for i, l := range c.listeners {
+		l.Close()
+		c.Servers[i].Close()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClusterAddIsVisibleFromEveryNodeViaOwnerForwarding(t *testing.T) {
+	cluster, err := NewCluster(3)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer cluster.Close()
+
+	const key, value = "integration-key", "integration-value"
+
+	addURL := fmt.Sprintf("%s/add?key=%s&value=%s", cluster.Servers[0].self, key, value)
+	if err := waitForOK(addURL); err != nil {
+		t.Fatalf("GET %s: %v", addURL, err)
+	}
+
+	want := fmt.Sprintf("{%q:%q}\n", "value", value)
+	for _, s := range cluster.Servers {
+		getURL := fmt.Sprintf("%s/get?key=%s", s.self, key)
+		body, status, err := get(getURL)
+		if err != nil {
+			t.Fatalf("GET %s: %v", getURL, err)
+		}
+		if status != http.StatusOK {
+			t.Fatalf("GET %s: status %d, body %q", getURL, status, body)
+		}
+		if body != want {
+			t.Errorf("GET %s body = %q, want %q", getURL, body, want)
+		}
+	}
+}
+
+// waitForOK retries a GET against url until it succeeds with 200, to
+// tolerate the cluster's Serve goroutines not having started accepting
+// connections yet.
+func waitForOK(url string) error {
+	var lastErr error
+	for i := 0; i < 50; i++ {
+		body, status, err := get(url)
+		if err == nil && status == http.StatusOK {
+			return nil
+		}
+		lastErr = fmt.Errorf("status %d, body %q, err %v", status, body, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	return lastErr
+}
+
+func get(url string) (body string, status int, err error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", resp.StatusCode, err
+	}
+	return string(b), resp.StatusCode, nil
+}